@@ -4,15 +4,20 @@ Entry point class for the CLIv2 version.
 package cliv2
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"bytes"
+	"github.com/gofrs/flock"
 	"github.com/snyk/cli-extension-lib-go"
 	"github.com/snyk/cli-extension-lib-go/extension"
 	"github.com/snyk/cli/cliv2/internal/embedded"
@@ -41,6 +46,8 @@ type EnvironmentWarning struct {
 
 const SNYK_EXIT_CODE_OK = 0
 const SNYK_EXIT_CODE_ERROR = 2
+const SNYK_EXIT_CODE_TIMEOUT = 3
+const SNYK_TIMEOUT_ENV = "SNYK_TIMEOUT"
 const SNYK_INTEGRATION_NAME = "CLI_V1_PLUGIN"
 const SNYK_INTEGRATION_NAME_ENV = "SNYK_INTEGRATION_NAME"
 const SNYK_INTEGRATION_VERSION_ENV = "SNYK_INTEGRATION_VERSION"
@@ -53,12 +60,43 @@ const SNYK_NPM_HTTP_PROXY_ENV = "NPM_CONFIG_HTTP_PROXY"
 const SNYK_NPM_NO_PROXY_ENV = "NPM_CONFIG_NO_PROXY"
 const SNYK_NPM_ALL_PROXY = "ALL_PROXY"
 const SNYK_CA_CERTIFICATE_LOCATION_ENV = "NODE_EXTRA_CA_CERTS"
+const SNYK_API_ENV = "SNYK_API"
+const SNYK_PROXY_SCHEME_HTTP = "http"
+const SNYK_PROXY_SCHEME_SOCKS5 = "socks5"
+const SNYK_EXTENSION_OUTPUT_FORMAT_ENV = "SNYK_EXTENSION_OUTPUT_FORMAT"
+const SNYK_CLIV1_EXTRACTION_LOCK_TIMEOUT_ENV = "SNYK_CLIV1_EXTRACTION_LOCK_TIMEOUT"
 
 const (
 	V1_DEFAULT Handler = iota
 	V2_VERSION Handler = iota
 )
 
+// timeoutFlagName bounds the overall execution time of the wrapped CLIv1 process or extension.
+const timeoutFlagName = "timeout"
+
+const endpointFlagName = "endpoint"
+
+const proxySchemeFlagName = "proxy-scheme"
+
+const outputFormatFlagName = "output-format"
+
+// v1ProcessTerminationGracePeriod is the SIGTERM-to-SIGKILL grace period for a timed-out child.
+const v1ProcessTerminationGracePeriod = 2 * time.Second
+
+const v1BinaryExtractionLockFile = "cliv1.lock"
+const v1BinaryExtractionLockTimeout = 30 * time.Second
+const v1BinaryExtractionLockRetryDelay = 50 * time.Millisecond
+
+func resolveV1BinaryExtractionLockTimeout() time.Duration {
+	if value, ok := os.LookupEnv(SNYK_CLIV1_EXTRACTION_LOCK_TIMEOUT_ENV); ok {
+		if timeout, err := time.ParseDuration(value); err == nil {
+			return timeout
+		}
+	}
+
+	return v1BinaryExtractionLockTimeout
+}
+
 //go:embed cliv2.version
 var SNYK_CLIV2_VERSION_PART string
 
@@ -86,17 +124,114 @@ func NewCLIv2(cacheDirectory string, extensions []*extension.Extension, argParse
 		return nil
 	}
 
+	if argParserRootCmd != nil {
+		argParserRootCmd.PersistentFlags().Duration(timeoutFlagName, 0, "Maximum duration to allow the command to run before it is terminated, e.g. 30s, 5m. Can also be set via SNYK_TIMEOUT.")
+		argParserRootCmd.PersistentFlags().String(endpointFlagName, "", "Snyk API endpoint to use, e.g. for on-prem or regional (EU/AU) tenants. Can also be set via SNYK_API.")
+		argParserRootCmd.PersistentFlags().String(proxySchemeFlagName, SNYK_PROXY_SCHEME_HTTP, "Scheme the local wrapper proxy listens as and is advertised to CLIv1/extensions with: http or socks5.")
+		argParserRootCmd.PersistentFlags().String(outputFormatFlagName, "", "Render a consolidated report from matched extensions' structured output, e.g. json. Unset keeps each extension's own output as-is.")
+	}
+
 	return &cli
 }
 
+// resolveTimeout prefers --timeout over SNYK_TIMEOUT, returning zero for no deadline.
+func (c *CLI) resolveTimeout() time.Duration {
+	if c.ArgParserRootCmd != nil {
+		if flag := c.ArgParserRootCmd.PersistentFlags().Lookup(timeoutFlagName); flag != nil && flag.Changed {
+			if timeout, err := c.ArgParserRootCmd.PersistentFlags().GetDuration(timeoutFlagName); err == nil {
+				return timeout
+			}
+		}
+	}
+
+	if value, ok := os.LookupEnv(SNYK_TIMEOUT_ENV); ok {
+		if timeout, err := time.ParseDuration(value); err == nil {
+			return timeout
+		}
+	}
+
+	return 0
+}
+
+func (c *CLI) resolveEndpoint() string {
+	if c.ArgParserRootCmd != nil {
+		if flag := c.ArgParserRootCmd.PersistentFlags().Lookup(endpointFlagName); flag != nil && flag.Changed {
+			if endpoint, err := c.ArgParserRootCmd.PersistentFlags().GetString(endpointFlagName); err == nil {
+				return endpoint
+			}
+		}
+	}
+
+	return ""
+}
+
+func (c *CLI) resolveProxyScheme() (string, error) {
+	if c.ArgParserRootCmd != nil {
+		if flag := c.ArgParserRootCmd.PersistentFlags().Lookup(proxySchemeFlagName); flag != nil && flag.Changed {
+			scheme, err := c.ArgParserRootCmd.PersistentFlags().GetString(proxySchemeFlagName)
+			if err != nil {
+				return "", err
+			}
+
+			switch scheme {
+			case SNYK_PROXY_SCHEME_HTTP, SNYK_PROXY_SCHEME_SOCKS5:
+				return scheme, nil
+			default:
+				return "", fmt.Errorf("unsupported --proxy-scheme %q: must be %q or %q", scheme, SNYK_PROXY_SCHEME_HTTP, SNYK_PROXY_SCHEME_SOCKS5)
+			}
+		}
+	}
+
+	return SNYK_PROXY_SCHEME_HTTP, nil
+}
+
+// resolveOutputFormat returns --output-format, or "" when unset.
+func (c *CLI) resolveOutputFormat() string {
+	if c.ArgParserRootCmd != nil {
+		if flag := c.ArgParserRootCmd.PersistentFlags().Lookup(outputFormatFlagName); flag != nil && flag.Changed {
+			if outputFormat, err := c.ArgParserRootCmd.PersistentFlags().GetString(outputFormatFlagName); err == nil {
+				return outputFormat
+			}
+		}
+	}
+
+	return ""
+}
+
 func (c *CLI) ExtractV1Binary() error {
 	cliV1ExpectedSHA256 := cliv1.ExpectedSHA256()
 
 	isValid, err := embedded.ValidateFile(c.v1BinaryLocation, cliV1ExpectedSHA256, c.DebugLogger)
+	if err == nil && isValid {
+		c.DebugLogger.Println("cliv1 already exists and is valid at", c.v1BinaryLocation)
+		return nil
+	}
+
+	// multiple snyk processes can start concurrently on the same machine (e.g. parallel CI
+	// jobs sharing a cache dir), so guard the validate->extract->revalidate sequence with an
+	// advisory file lock to avoid two processes racing to write v1BinaryLocation
+	lockPath := filepath.Join(c.CacheDirectory, v1BinaryExtractionLockFile)
+	fileLock := flock.New(lockPath)
+
+	lockCtx, cancel := context.WithTimeout(context.Background(), resolveV1BinaryExtractionLockTimeout())
+	defer cancel()
+
+	locked, err := fileLock.TryLockContext(lockCtx, v1BinaryExtractionLockRetryDelay)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock for cliv1 extraction at %s: %w", lockPath, err)
+	}
+	if !locked {
+		return fmt.Errorf("timed out waiting for lock to extract cliv1 binary: %s", lockPath)
+	}
+	defer fileLock.Unlock()
+
+	// re-validate now that the lock is held: another process may have already extracted a
+	// valid binary while this one was waiting
+	isValid, err = embedded.ValidateFile(c.v1BinaryLocation, cliV1ExpectedSHA256, c.DebugLogger)
 	if err != nil || !isValid {
 		c.DebugLogger.Println("cliv1 is not valid, start extracting ", c.v1BinaryLocation)
 
-		err = cliv1.ExtractTo(c.v1BinaryLocation)
+		err = c.extractV1BinaryAtomically()
 		if err != nil {
 			return err
 		}
@@ -113,12 +248,31 @@ func (c *CLI) ExtractV1Binary() error {
 			return err
 		}
 	} else {
-		c.DebugLogger.Println("cliv1 already exists and is valid at", c.v1BinaryLocation)
+		c.DebugLogger.Println("cliv1 already extracted by another process while waiting for lock at", c.v1BinaryLocation)
 	}
 
 	return nil
 }
 
+func (c *CLI) extractV1BinaryAtomically() error {
+	targetDir := filepath.Dir(c.v1BinaryLocation)
+
+	tempFile, err := os.CreateTemp(targetDir, "cliv1-*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	os.Remove(tempPath)
+	defer os.Remove(tempPath)
+
+	if err := cliv1.ExtractTo(tempPath); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, c.v1BinaryLocation)
+}
+
 func (c *CLI) GetFullVersion() string {
 	return c.v2Version + "." + c.v1Version
 }
@@ -157,22 +311,60 @@ func determineHandler(passthroughArgs []string) Handler {
 	return result
 }
 
-func PrepareV1EnvironmentVariables(input []string, integrationName string, integrationVersion string, proxyAddress string, caCertificateLocation string) (result []string, err error) {
+// mergeNoProxyValues combines a pre-existing NO_PROXY-style value (comma-separated hosts)
+// with the set of hosts that must stay internal to the cliv1<->cliv2 bridge, trimming
+// whitespace and de-duplicating entries. The user's own entries are kept first, in their
+// original order, with the internal hosts appended after so the result stays readable and
+// deterministic; the internal hosts are always present so local communication can never be
+// accidentally redirected through the proxy.
+func mergeNoProxyValues(existing string, internalHosts []string) string {
+	seen := make(map[string]bool)
+	merged := []string{}
+
+	add := func(raw string) {
+		host := strings.TrimSpace(raw)
+		if host == "" || seen[host] {
+			return
+		}
+		seen[host] = true
+		merged = append(merged, host)
+	}
+
+	for _, host := range strings.Split(existing, ",") {
+		add(host)
+	}
+
+	for _, host := range internalHosts {
+		add(host)
+	}
+
+	return strings.Join(merged, ",")
+}
+
+func PrepareV1EnvironmentVariables(input []string, integrationName string, integrationVersion string, proxyAddress string, proxyScheme string, caCertificateLocation string, internalNoProxyHosts []string, endpoint string) (result []string, err error) {
 	inputAsMap := utils.ToKeyValueMap(input, "=")
 	result = input
 
 	_, integrationNameExists := inputAsMap[SNYK_INTEGRATION_NAME_ENV]
 	_, integrationVersionExists := inputAsMap[SNYK_INTEGRATION_VERSION_ENV]
 
-	if !integrationNameExists && !integrationVersionExists {
-		inputAsMap[SNYK_INTEGRATION_NAME_ENV] = integrationName
-		inputAsMap[SNYK_INTEGRATION_VERSION_ENV] = integrationVersion
-	} else if !(integrationNameExists && integrationVersionExists) {
-		err = EnvironmentWarning{message: fmt.Sprintf("Partially defined environment, please ensure to provide both %s and %s together!", SNYK_INTEGRATION_NAME_ENV, SNYK_INTEGRATION_VERSION_ENV)}
+	if integrationName != "" || integrationVersion != "" {
+		if !integrationNameExists && !integrationVersionExists {
+			inputAsMap[SNYK_INTEGRATION_NAME_ENV] = integrationName
+			inputAsMap[SNYK_INTEGRATION_VERSION_ENV] = integrationVersion
+		} else if !(integrationNameExists && integrationVersionExists) {
+			err = EnvironmentWarning{message: fmt.Sprintf("Partially defined environment, please ensure to provide both %s and %s together!", SNYK_INTEGRATION_NAME_ENV, SNYK_INTEGRATION_VERSION_ENV)}
+		}
 	}
 
 	if err == nil {
-		// apply blacklist: ensure that no existing no_proxy or other configuration causes redirecting internal communication that is meant to stay between cliv1 and cliv2
+		// preserve any user-defined NO_PROXY / NPM_CONFIG_NO_PROXY values, merging in the
+		// hosts that must stay internal to the cliv1<->cliv2 bridge rather than dropping them
+		mergedNoProxy := mergeNoProxyValues(inputAsMap[SNYK_HTTP_NO_PROXY_ENV], internalNoProxyHosts)
+		mergedNpmNoProxy := mergeNoProxyValues(inputAsMap[SNYK_NPM_NO_PROXY_ENV], internalNoProxyHosts)
+
+		// apply blacklist: ensure that no existing proxy configuration causes redirecting
+		// internal communication that is meant to stay between cliv1 and cliv2
 		blackList := []string{
 			SNYK_HTTPS_PROXY_ENV,
 			SNYK_HTTP_PROXY_ENV,
@@ -189,10 +381,25 @@ func PrepareV1EnvironmentVariables(input []string, integrationName string, integ
 			inputAsMap = utils.Remove(inputAsMap, key)
 		}
 
-		// fill expected values
-		inputAsMap[SNYK_HTTPS_PROXY_ENV] = proxyAddress
-		inputAsMap[SNYK_HTTP_PROXY_ENV] = proxyAddress
+		// fill expected values; SOCKS5 proxies are advertised via ALL_PROXY/NPM_CONFIG_PROXY
+		// since HTTPS_PROXY/HTTP_PROXY only support HTTP CONNECT proxies
+		if proxyScheme == SNYK_PROXY_SCHEME_SOCKS5 {
+			inputAsMap[SNYK_NPM_ALL_PROXY] = proxyAddress
+			inputAsMap[SNYK_NPM_PROXY_ENV] = proxyAddress
+		} else {
+			inputAsMap[SNYK_HTTPS_PROXY_ENV] = proxyAddress
+			inputAsMap[SNYK_HTTP_PROXY_ENV] = proxyAddress
+		}
 		inputAsMap[SNYK_CA_CERTIFICATE_LOCATION_ENV] = caCertificateLocation
+		inputAsMap[SNYK_HTTP_NO_PROXY_ENV] = mergedNoProxy
+		inputAsMap[SNYK_NPM_NO_PROXY_ENV] = mergedNpmNoProxy
+
+		// only override SNYK_API when an endpoint was explicitly configured; otherwise leave
+		// whatever is already in the inherited environment (or nothing) so env-provided
+		// configuration and downstream defaults keep working
+		if endpoint != "" {
+			inputAsMap[SNYK_API_ENV] = endpoint
+		}
 
 		result = utils.ToSlice(inputAsMap, "=")
 	}
@@ -201,11 +408,24 @@ func PrepareV1EnvironmentVariables(input []string, integrationName string, integ
 
 }
 
-func PrepareV1Command(cmd string, args []string, proxyPort int, caCertLocation string, integrationName string, integrationVersion string) (snykCmd *exec.Cmd, err error) {
-	proxyAddress := fmt.Sprintf("http://127.0.0.1:%d", proxyPort)
+// defaultInternalNoProxyHosts are the hosts that must always bypass the local wrapper
+// proxy, regardless of what the user has configured, since they refer to the loopback
+// address the wrapper proxy itself listens on.
+var defaultInternalNoProxyHosts = []string{"127.0.0.1", "localhost"}
 
-	snykCmd = exec.Command(cmd, args...)
-	snykCmd.Env, err = PrepareV1EnvironmentVariables(os.Environ(), integrationName, integrationVersion, proxyAddress, caCertLocation)
+func formatProxyAddress(proxyScheme string, proxyPort int) string {
+	return fmt.Sprintf("%s://127.0.0.1:%d", proxyScheme, proxyPort)
+}
+
+func PrepareV1Command(ctx context.Context, cmd string, args []string, proxyPort int, proxyScheme string, caCertLocation string, integrationName string, integrationVersion string, endpoint string) (snykCmd *exec.Cmd, err error) {
+	proxyAddress := formatProxyAddress(proxyScheme, proxyPort)
+
+	snykCmd = exec.CommandContext(ctx, cmd, args...)
+	snykCmd.Cancel = func() error {
+		return snykCmd.Process.Signal(syscall.SIGTERM)
+	}
+	snykCmd.WaitDelay = v1ProcessTerminationGracePeriod
+	snykCmd.Env, err = PrepareV1EnvironmentVariables(os.Environ(), integrationName, integrationVersion, proxyAddress, proxyScheme, caCertLocation, defaultInternalNoProxyHosts, endpoint)
 	snykCmd.Stdin = os.Stdin
 	snykCmd.Stdout = os.Stdout
 	snykCmd.Stderr = os.Stderr
@@ -213,17 +433,26 @@ func PrepareV1Command(cmd string, args []string, proxyPort int, caCertLocation s
 	return snykCmd, err
 }
 
-func (c *CLI) executeV1Default(wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int {
+func (c *CLI) executeV1Default(ctx context.Context, wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int {
 	c.DebugLogger.Println("launching snyk with path: ", c.v1BinaryLocation)
 	c.DebugLogger.Println("fullPathToCert:", fullPathToCert)
 
+	proxyScheme, err := c.resolveProxyScheme()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return SNYK_EXIT_CODE_ERROR
+	}
+
 	snykCmd, err := PrepareV1Command(
+		ctx,
 		c.v1BinaryLocation,
 		passthroughArgs,
 		wrapperProxyPort,
+		proxyScheme,
 		fullPathToCert,
 		c.GetIntegrationName(),
 		c.GetFullVersion(),
+		c.resolveEndpoint(),
 	)
 
 	if err != nil {
@@ -234,7 +463,10 @@ func (c *CLI) executeV1Default(wrapperProxyPort int, fullPathToCert string, pass
 
 	err = snykCmd.Run()
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
+		if ctx.Err() == context.DeadlineExceeded {
+			fmt.Fprintln(os.Stderr, "Error: command timed out and was terminated, see --timeout/SNYK_TIMEOUT")
+			return SNYK_EXIT_CODE_TIMEOUT
+		} else if exitError, ok := err.(*exec.ExitError); ok {
 			exitCode := exitError.ExitCode()
 			return exitCode
 		} else {
@@ -250,16 +482,40 @@ func (c *CLI) executeV1Default(wrapperProxyPort int, fullPathToCert string, pass
 func (c *CLI) Execute(wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int {
 	c.DebugLogger.Println("passthroughArgs", passthroughArgs)
 
+	proxyScheme, err := c.resolveProxyScheme()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return exit_codes.SNYK_EXIT_CODE_ERROR
+	}
+
+	// the http-scheme wrapper proxy is started and owned by the caller before Execute is
+	// invoked (it also handles CA injection for MITM'd requests), so only bind our own
+	// listener for socks5, which has no pre-existing listener to conflict with.
+	if proxyScheme == SNYK_PROXY_SCHEME_SOCKS5 {
+		wrapperProxyListener, err := ListenWrapperProxy(proxyScheme, wrapperProxyPort)
+		if err != nil {
+			fmt.Println("Error starting wrapper proxy:", err)
+			return exit_codes.SNYK_EXIT_CODE_ERROR
+		}
+		defer wrapperProxyListener.Close()
+	}
+
+	ctx := context.Background()
+	if timeout := c.resolveTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	maybeMatchingBuiltinHandler := c.matchBuiltInHandler(passthroughArgs)
 	if maybeMatchingBuiltinHandler != nil {
 		c.DebugLogger.Println("matched built-in handler for: ", passthroughArgs)
-		return maybeMatchingBuiltinHandler.Execute(wrapperProxyPort, fullPathToCert, passthroughArgs)
+		return maybeMatchingBuiltinHandler.Execute(ctx, wrapperProxyPort, fullPathToCert, passthroughArgs)
 	}
 
-	maybeMatchingExtension := matchExtension(passthroughArgs, c.Extensions)
-	if maybeMatchingExtension != nil {
-		matchedExtension := maybeMatchingExtension
-		c.DebugLogger.Println("matched extension:", matchedExtension)
+	matchedExtensions := matchExtensions(passthroughArgs, c.Extensions)
+	if len(matchedExtensions) > 0 {
+		c.DebugLogger.Println("matched extensions:", matchedExtensions)
 
 		matchedCommand, _, err := c.ArgParserRootCmd.Find(passthroughArgs)
 		if err != nil {
@@ -267,19 +523,47 @@ func (c *CLI) Execute(wrapperProxyPort int, fullPathToCert string, passthroughAr
 			return exit_codes.SNYK_EXIT_CODE_ERROR
 		}
 
-		extensionInput := MakeExtensionInput(matchedExtension.Metadata, matchedCommand, passthroughArgs, c.debugMode, wrapperProxyPort)
-		if err != nil {
-			fmt.Println(err)
-			return exit_codes.SNYK_EXIT_CODE_ERROR
+		outputFormat := c.resolveOutputFormat()
+		exitCode := exit_codes.SNYK_EXIT_CODE_OK
+		results := make([]ExtensionResult, 0, len(matchedExtensions))
+
+		for _, matchedExtension := range matchedExtensions {
+			if extensionDeadlineExceeded(ctx) {
+				c.DebugLogger.Println("deadline exceeded, skipping remaining extensions")
+				break
+			}
+
+			extensionInput := MakeExtensionInput(matchedExtension.Metadata, matchedCommand, passthroughArgs, c.debugMode, wrapperProxyPort)
+			utils.PrettyLogObject(extensionInput, c.DebugLogger)
+
+			result, extensionExitCode := LaunchExtension(ctx, matchedExtension, extensionInput, wrapperProxyPort, proxyScheme, fullPathToCert, c.resolveEndpoint(), outputFormat, c.DebugLogger)
+			if extensionExitCode > exitCode {
+				exitCode = extensionExitCode
+			}
+			if result != nil {
+				results = append(results, *result)
+			}
 		}
-		utils.PrettyLogObject(extensionInput, c.DebugLogger)
-		return LaunchExtension(matchedExtension, extensionInput, wrapperProxyPort, fullPathToCert, c.DebugLogger)
+
+		// with no output format requested, every matched extension has already written its
+		// own output directly (legacy passthrough behavior); only render a consolidated
+		// report when the caller asked for one
+		if outputFormat != "" && len(results) > 0 {
+			rendered, err := renderExtensionResult(aggregateExtensionResults(results), outputFormat)
+			if err != nil {
+				fmt.Println("Error rendering extension output:", err)
+				return exit_codes.SNYK_EXIT_CODE_ERROR
+			}
+			fmt.Println(rendered)
+		}
+
+		return exitCode
 	}
 
 	c.DebugLogger.Println("No matching built-in handlers or extensions. Falling back on CLIv1")
 
 	// fall-back on CLIv1
-	return c.executeV1Default(wrapperProxyPort, fullPathToCert, passthroughArgs)
+	return c.executeV1Default(ctx, wrapperProxyPort, fullPathToCert, passthroughArgs)
 }
 
 func (e EnvironmentWarning) Error() string {
@@ -287,14 +571,14 @@ func (e EnvironmentWarning) Error() string {
 }
 
 type CommandHandler interface {
-	Execute(wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int
+	Execute(ctx context.Context, wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int
 }
 
 type VersionHandler struct {
 	cli *CLI
 }
 
-func (v *VersionHandler) Execute(wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int {
+func (v *VersionHandler) Execute(ctx context.Context, wrapperProxyPort int, fullPathToCert string, passthroughArgs []string) int {
 	if utils.Contains(passthroughArgs, "--json-file-output") {
 		fmt.Println("The following option combination is not currently supported: version + json-file-output")
 		return exit_codes.SNYK_EXIT_CODE_ERROR
@@ -315,26 +599,32 @@ func (c *CLI) matchBuiltInHandler(args []string) CommandHandler {
 	return nil
 }
 
-func matchExtension(args []string, extensions []*extension.Extension) *extension.Extension {
+func extensionDeadlineExceeded(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+func matchExtensions(args []string, extensions []*extension.Extension) []*extension.Extension {
+	var matched []*extension.Extension
+
 	if len(args) > 0 {
 		maybeCommand := args[0]
 		for _, x := range extensions {
 			if x.Metadata.Command.Name == maybeCommand {
-				return x
+				matched = append(matched, x)
 			}
 		}
 	}
 
-	return nil
+	return matched
 }
 
-func LaunchExtension(extension *extension.Extension, extensionInput *cli_extension_lib_go.ExtensionInput, proxyPort int, caCertLocation string, debugLogger *log.Logger) int {
+func LaunchExtension(ctx context.Context, extension *extension.Extension, extensionInput *cli_extension_lib_go.ExtensionInput, proxyPort int, proxyScheme string, caCertLocation string, endpoint string, outputFormat string, debugLogger *log.Logger) (*ExtensionResult, int) {
 	debugLogger.Println("launching extension:", extension.Metadata.Name)
 
 	extensionInputJsonBytes, err := json.Marshal(extensionInput)
 	if err != nil {
 		fmt.Println("Error deserializing ExtensionInput", err)
-		return exit_codes.SNYK_EXIT_CODE_ERROR
+		return nil, exit_codes.SNYK_EXIT_CODE_ERROR
 	}
 
 	debugLogger.Println("extension input:\n", string(extensionInputJsonBytes))
@@ -343,35 +633,86 @@ func LaunchExtension(extension *extension.Extension, extensionInput *cli_extensi
 	_, err = os.Stat(extension.BinPath)
 	if err != nil {
 		fmt.Println("error: extension binary does not exist:", extension.BinPath)
-		return exit_codes.SNYK_EXIT_CODE_ERROR
+		return nil, exit_codes.SNYK_EXIT_CODE_ERROR
 	}
 
-	cmd := exec.Command(extension.BinPath)
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("HTTPS_PROXY=http://127.0.0.1:%d", proxyPort),
-		fmt.Sprintf("NODE_EXTRA_CA_CERTS=%s", caCertLocation),
+	cmd := exec.CommandContext(ctx, extension.BinPath)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = v1ProcessTerminationGracePeriod
+	cmd.Env, err = PrepareV1EnvironmentVariables(
+		os.Environ(),
+		"",
+		"",
+		formatProxyAddress(proxyScheme, proxyPort),
+		proxyScheme,
+		caCertLocation,
+		defaultInternalNoProxyHosts,
+		endpoint,
 	)
+	if err != nil {
+		if evWarning, ok := err.(EnvironmentWarning); ok {
+			fmt.Println("WARNING! ", evWarning)
+		}
+	}
 
-	cmd.Stdout = os.Stdout
+	var stdoutCapture bytes.Buffer
+	if outputFormat != "" {
+		// tell the extension which machine format was requested so it can suppress its own
+		// human-readable passthrough instead of emitting it ahead of the NDJSON trailer
+		cmd.Env = append(cmd.Env, SNYK_EXTENSION_OUTPUT_FORMAT_ENV+"="+outputFormat)
+		cmd.Stdout = &stdoutCapture
+	} else {
+		cmd.Stdout = os.Stdout
+	}
 	cmd.Stderr = os.Stderr
-	buffer := bytes.Buffer{}
-	buffer.Write(extensionInputJsonBytes)
-	buffer.WriteString("\n\n")
-	cmd.Stdin = &buffer
+	inputBuffer := bytes.Buffer{}
+	inputBuffer.Write(extensionInputJsonBytes)
+	inputBuffer.WriteString("\n\n")
+	cmd.Stdin = &inputBuffer
 
 	cmd.Start()
 	err = cmd.Wait()
 
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
+		if ctx.Err() == context.DeadlineExceeded {
+			fmt.Fprintln(os.Stderr, "Error: extension timed out and was terminated, see --timeout/SNYK_TIMEOUT")
+			return nil, SNYK_EXIT_CODE_TIMEOUT
+		} else if exitError, ok := err.(*exec.ExitError); ok {
 			exitCode := exitError.ExitCode()
-			return exitCode
+			if outputFormat == "" {
+				return nil, exitCode
+			}
+			result := buildExtensionResult(&stdoutCapture, exitCode, debugLogger)
+			return &result, exitCode
 		} else {
 			// got an error but it's not an ExitError
 			fmt.Println("error launching extension:", err)
-			return exit_codes.SNYK_EXIT_CODE_ERROR
+			return nil, exit_codes.SNYK_EXIT_CODE_ERROR
 		}
 	}
 
-	return exit_codes.SNYK_EXIT_CODE_OK
+	if outputFormat == "" {
+		return nil, exit_codes.SNYK_EXIT_CODE_OK
+	}
+
+	result := buildExtensionResult(&stdoutCapture, exit_codes.SNYK_EXIT_CODE_OK, debugLogger)
+	return &result, exit_codes.SNYK_EXIT_CODE_OK
+}
+
+func buildExtensionResult(stdout *bytes.Buffer, exitCode int, debugLogger *log.Logger) ExtensionResult {
+	passthrough, events, err := parseExtensionOutput(stdout)
+	if err != nil {
+		debugLogger.Println("failed to parse extension output:", err)
+		return ExtensionResult{ExitCode: exitCode}
+	}
+
+	// a structured format was requested, so stdout must carry only the rendered document;
+	// send any pre-sentinel human passthrough to stderr instead of interleaving it with JSON/SARIF
+	if passthrough != "" {
+		fmt.Fprintln(os.Stderr, passthrough)
+	}
+
+	return extensionResultFromEvents(events, exitCode)
 }
@@ -0,0 +1,367 @@
+package cliv2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snyk/cli-extension-lib-go"
+	"github.com/snyk/cli-extension-lib-go/extension"
+	"github.com/snyk/cli/cliv2/internal/exit_codes"
+	"github.com/spf13/cobra"
+)
+
+func envValue(env []string, key string) (string, bool) {
+	prefix := key + "="
+	for _, entry := range env {
+		if len(entry) >= len(prefix) && entry[:len(prefix)] == prefix {
+			return entry[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+func TestPrepareV1EnvironmentVariables_NoProxyMerge(t *testing.T) {
+	internalHosts := []string{"127.0.0.1", "localhost"}
+
+	tests := []struct {
+		name               string
+		input              []string
+		expectedNoProxy    string
+		expectedNpmNoProxy string
+	}{
+		{
+			name:               "no user value",
+			input:              []string{},
+			expectedNoProxy:    "127.0.0.1,localhost",
+			expectedNpmNoProxy: "127.0.0.1,localhost",
+		},
+		{
+			name:               "user value with overlap",
+			input:              []string{"NO_PROXY=localhost,example.com"},
+			expectedNoProxy:    "localhost,example.com,127.0.0.1",
+			expectedNpmNoProxy: "127.0.0.1,localhost",
+		},
+		{
+			name:               "user value with wildcard",
+			input:              []string{"NO_PROXY=.internal.corp"},
+			expectedNoProxy:    ".internal.corp,127.0.0.1,localhost",
+			expectedNpmNoProxy: "127.0.0.1,localhost",
+		},
+		{
+			name:               "both vars present with different contents",
+			input:              []string{"NO_PROXY=example.com", "NPM_CONFIG_NO_PROXY=example.org"},
+			expectedNoProxy:    "example.com,127.0.0.1,localhost",
+			expectedNpmNoProxy: "example.org,127.0.0.1,localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := PrepareV1EnvironmentVariables(tt.input, "", "", "http://127.0.0.1:9000", SNYK_PROXY_SCHEME_HTTP, "", internalHosts, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			noProxy, _ := envValue(result, SNYK_HTTP_NO_PROXY_ENV)
+			if noProxy != tt.expectedNoProxy {
+				t.Errorf("NO_PROXY = %q, want %q", noProxy, tt.expectedNoProxy)
+			}
+
+			npmNoProxy, _ := envValue(result, SNYK_NPM_NO_PROXY_ENV)
+			if npmNoProxy != tt.expectedNpmNoProxy {
+				t.Errorf("NPM_CONFIG_NO_PROXY = %q, want %q", npmNoProxy, tt.expectedNpmNoProxy)
+			}
+		})
+	}
+}
+
+func TestPrepareV1Command_TimeoutTerminatesProcess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	cmd, err := PrepareV1Command(ctx, "sleep", []string{"5"}, 0, SNYK_PROXY_SCHEME_HTTP, "", "", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	_ = cmd.Run()
+	elapsed := time.Since(start)
+
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("expected deadline to be exceeded, got: %v", ctx.Err())
+	}
+	if elapsed >= 5*time.Second {
+		t.Fatalf("process was not terminated on timeout, took %v", elapsed)
+	}
+}
+
+func TestPrepareV1Command_NoTimeoutRunsToCompletion(t *testing.T) {
+	cmd, err := PrepareV1Command(context.Background(), "true", nil, 0, SNYK_PROXY_SCHEME_HTTP, "", "", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("expected command to run to completion, got: %v", err)
+	}
+}
+
+func TestLaunchExtension_Timeout(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "slow-extension.sh")
+	script := "#!/bin/sh\nsleep 5\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write test extension script: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	ext := &extension.Extension{
+		BinPath:  scriptPath,
+		Metadata: extension.Metadata{Name: "test-extension"},
+	}
+
+	start := time.Now()
+	_, exitCode := LaunchExtension(ctx, ext, &cli_extension_lib_go.ExtensionInput{}, 0, SNYK_PROXY_SCHEME_HTTP, "", "", "", log.New(io.Discard, "", 0))
+	elapsed := time.Since(start)
+
+	if exitCode != SNYK_EXIT_CODE_TIMEOUT {
+		t.Fatalf("expected timeout exit code %d, got %d", SNYK_EXIT_CODE_TIMEOUT, exitCode)
+	}
+	if elapsed >= 5*time.Second {
+		t.Fatalf("extension was not terminated on timeout, took %v", elapsed)
+	}
+}
+
+func TestLaunchExtension_SignalsOutputFormatToExtension(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "env-capture.txt")
+	scriptPath := filepath.Join(t.TempDir(), "capture-format.sh")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s' \"$%s\" > %s\n", SNYK_EXTENSION_OUTPUT_FORMAT_ENV, outFile)
+	if err := os.WriteFile(scriptPath, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write test extension script: %v", err)
+	}
+
+	ext := &extension.Extension{
+		BinPath:  scriptPath,
+		Metadata: extension.Metadata{Name: "test-extension"},
+	}
+
+	_, exitCode := LaunchExtension(context.Background(), ext, &cli_extension_lib_go.ExtensionInput{}, 0, SNYK_PROXY_SCHEME_HTTP, "", "", "json", log.New(io.Discard, "", 0))
+	if exitCode != SNYK_EXIT_CODE_OK {
+		t.Fatalf("expected extension to run successfully, got exit code %d", exitCode)
+	}
+
+	got, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("failed to read captured env output: %v", err)
+	}
+	if string(got) != "json" {
+		t.Fatalf("%s = %q, want %q", SNYK_EXTENSION_OUTPUT_FORMAT_ENV, got, "json")
+	}
+}
+
+func TestExtractV1Binary_ConcurrentCallersExtractOnce(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	// log.Logger serializes writes, so the buffer is safe to share across goroutines
+	var debugOutput bytes.Buffer
+	cli := &CLI{
+		DebugLogger:      log.New(&debugOutput, "", 0),
+		CacheDirectory:   cacheDir,
+		v1BinaryLocation: filepath.Join(cacheDir, "snyk-cliv1"),
+	}
+
+	const concurrentCallers = 10
+	errs := make(chan error, concurrentCallers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrentCallers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- cli.ExtractV1Binary()
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error from concurrent ExtractV1Binary: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(cli.v1BinaryLocation); err != nil {
+		t.Fatalf("expected v1 binary to exist after extraction, got: %v", err)
+	}
+
+	if extractions := strings.Count(debugOutput.String(), "start extracting"); extractions != 1 {
+		t.Fatalf("expected exactly one extraction across %d concurrent callers, got %d", concurrentCallers, extractions)
+	}
+}
+
+func TestPrepareV1EnvironmentVariables_Endpoint(t *testing.T) {
+	internalHosts := []string{"127.0.0.1", "localhost"}
+
+	t.Run("flag-provided endpoint wins over env", func(t *testing.T) {
+		result, err := PrepareV1EnvironmentVariables([]string{"SNYK_API=https://existing.example.com"}, "", "", "http://127.0.0.1:9000", SNYK_PROXY_SCHEME_HTTP, "", internalHosts, "https://flag.example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		endpoint, _ := envValue(result, SNYK_API_ENV)
+		if endpoint != "https://flag.example.com" {
+			t.Errorf("SNYK_API = %q, want flag-provided value", endpoint)
+		}
+	})
+
+	t.Run("env-provided endpoint is preserved when no flag given", func(t *testing.T) {
+		result, err := PrepareV1EnvironmentVariables([]string{"SNYK_API=https://existing.example.com"}, "", "", "http://127.0.0.1:9000", SNYK_PROXY_SCHEME_HTTP, "", internalHosts, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		endpoint, _ := envValue(result, SNYK_API_ENV)
+		if endpoint != "https://existing.example.com" {
+			t.Errorf("SNYK_API = %q, want preserved env value", endpoint)
+		}
+	})
+
+	t.Run("default unset leaves no SNYK_API injected", func(t *testing.T) {
+		result, err := PrepareV1EnvironmentVariables([]string{}, "", "", "http://127.0.0.1:9000", SNYK_PROXY_SCHEME_HTTP, "", internalHosts, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, ok := envValue(result, SNYK_API_ENV); ok {
+			t.Errorf("expected no SNYK_API to be injected when endpoint and env are both unset")
+		}
+	})
+}
+
+func TestPrepareV1EnvironmentVariables_ProxySchemes(t *testing.T) {
+	internalHosts := []string{"127.0.0.1", "localhost"}
+
+	t.Run("http scheme sets HTTPS_PROXY/HTTP_PROXY and clears SOCKS5 vars", func(t *testing.T) {
+		input := []string{"ALL_PROXY=socks5://stale:1080", "NPM_CONFIG_PROXY=socks5://stale:1080"}
+		result, err := PrepareV1EnvironmentVariables(input, "", "", "http://127.0.0.1:9000", SNYK_PROXY_SCHEME_HTTP, "", internalHosts, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if httpsProxy, _ := envValue(result, SNYK_HTTPS_PROXY_ENV); httpsProxy != "http://127.0.0.1:9000" {
+			t.Errorf("HTTPS_PROXY = %q, want http://127.0.0.1:9000", httpsProxy)
+		}
+		if httpProxy, _ := envValue(result, SNYK_HTTP_PROXY_ENV); httpProxy != "http://127.0.0.1:9000" {
+			t.Errorf("HTTP_PROXY = %q, want http://127.0.0.1:9000", httpProxy)
+		}
+		if _, ok := envValue(result, SNYK_NPM_ALL_PROXY); ok {
+			t.Errorf("expected stale ALL_PROXY to be scrubbed for http scheme")
+		}
+	})
+
+	t.Run("socks5 scheme sets ALL_PROXY/NPM_CONFIG_PROXY and clears HTTP vars", func(t *testing.T) {
+		input := []string{"HTTPS_PROXY=http://stale:8080", "HTTP_PROXY=http://stale:8080"}
+		result, err := PrepareV1EnvironmentVariables(input, "", "", "socks5://127.0.0.1:9000", SNYK_PROXY_SCHEME_SOCKS5, "", internalHosts, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if allProxy, _ := envValue(result, SNYK_NPM_ALL_PROXY); allProxy != "socks5://127.0.0.1:9000" {
+			t.Errorf("ALL_PROXY = %q, want socks5://127.0.0.1:9000", allProxy)
+		}
+		if npmProxy, _ := envValue(result, SNYK_NPM_PROXY_ENV); npmProxy != "socks5://127.0.0.1:9000" {
+			t.Errorf("NPM_CONFIG_PROXY = %q, want socks5://127.0.0.1:9000", npmProxy)
+		}
+		if _, ok := envValue(result, SNYK_HTTPS_PROXY_ENV); ok {
+			t.Errorf("expected stale HTTPS_PROXY to be scrubbed for socks5 scheme")
+		}
+		if _, ok := envValue(result, SNYK_HTTP_PROXY_ENV); ok {
+			t.Errorf("expected stale HTTP_PROXY to be scrubbed for socks5 scheme")
+		}
+	})
+}
+
+// newTestCLI builds a *CLI with just enough wiring (flags, debug logger) to exercise
+// Execute without going through NewCLIv2's real cliv1 binary extraction.
+func newTestCLI(t *testing.T, proxyScheme string) *CLI {
+	t.Helper()
+
+	rootCmd := &cobra.Command{Use: "snyk"}
+	rootCmd.PersistentFlags().Duration(timeoutFlagName, 0, "")
+	rootCmd.PersistentFlags().String(endpointFlagName, "", "")
+	rootCmd.PersistentFlags().String(proxySchemeFlagName, SNYK_PROXY_SCHEME_HTTP, "")
+	rootCmd.PersistentFlags().String(outputFormatFlagName, "", "")
+
+	if proxyScheme != "" {
+		if err := rootCmd.PersistentFlags().Set(proxySchemeFlagName, proxyScheme); err != nil {
+			t.Fatalf("failed to set proxy-scheme flag: %v", err)
+		}
+	}
+
+	return &CLI{
+		DebugLogger:      log.New(io.Discard, "", 0),
+		ArgParserRootCmd: rootCmd,
+	}
+}
+
+// TestExecute_HTTPSchemeDoesNotRebindCallerOwnedPort exercises Execute end-to-end against a
+// live port: the http-scheme wrapper proxy is started and owned by the caller before Execute
+// runs, so Execute must not try to listen on that same port itself.
+func TestExecute_HTTPSchemeDoesNotRebindCallerOwnedPort(t *testing.T) {
+	preboundListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to bind test port: %v", err)
+	}
+	defer preboundListener.Close()
+	proxyPort := listenerPort(t, preboundListener)
+
+	cli := newTestCLI(t, SNYK_PROXY_SCHEME_HTTP)
+
+	exitCode := cli.Execute(proxyPort, "", []string{"version"})
+	if exitCode != SNYK_EXIT_CODE_OK {
+		t.Fatalf("expected Execute to succeed without rebinding the caller-owned port, got exit code %d", exitCode)
+	}
+}
+
+// TestExecute_Socks5SchemeBindsOwnWrapperProxy exercises Execute end-to-end against a live
+// port for the socks5 scheme, which has no pre-existing listener and so must be bound by
+// Execute itself.
+func TestExecute_Socks5SchemeBindsOwnWrapperProxy(t *testing.T) {
+	cli := newTestCLI(t, SNYK_PROXY_SCHEME_SOCKS5)
+
+	exitCode := cli.Execute(0, "", []string{"version"})
+	if exitCode != SNYK_EXIT_CODE_OK {
+		t.Fatalf("expected Execute to succeed after binding its own socks5 wrapper proxy, got exit code %d", exitCode)
+	}
+}
+
+func TestExecute_RejectsUnknownProxyScheme(t *testing.T) {
+	cli := newTestCLI(t, "socks4")
+
+	exitCode := cli.Execute(0, "", []string{"version"})
+	if exitCode != exit_codes.SNYK_EXIT_CODE_ERROR {
+		t.Fatalf("expected unrecognized --proxy-scheme to fail loudly with exit code %d, got %d", exit_codes.SNYK_EXIT_CODE_ERROR, exitCode)
+	}
+}
+
+func TestFormatProxyAddress(t *testing.T) {
+	if got := formatProxyAddress(SNYK_PROXY_SCHEME_HTTP, 9000); got != "http://127.0.0.1:9000" {
+		t.Errorf("formatProxyAddress(http, 9000) = %q", got)
+	}
+	if got := formatProxyAddress(SNYK_PROXY_SCHEME_SOCKS5, 9000); got != "socks5://127.0.0.1:9000" {
+		t.Errorf("formatProxyAddress(socks5, 9000) = %q", got)
+	}
+}
@@ -0,0 +1,234 @@
+package cliv2
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExtensionEventType identifies the kind of structured event an extension emits on its
+// NDJSON output trailer.
+type ExtensionEventType string
+
+const (
+	ExtensionEventFinding  ExtensionEventType = "finding"
+	ExtensionEventProgress ExtensionEventType = "progress"
+	ExtensionEventSummary  ExtensionEventType = "summary"
+	ExtensionEventError    ExtensionEventType = "error"
+)
+
+// extensionOutputSentinel marks the start of the structured NDJSON trailer an extension
+// may write after any human-readable output it has already printed to stdout. Extensions
+// that never emit the sentinel are treated as pure legacy passthrough.
+const extensionOutputSentinel = "---SNYK-EXTENSION-OUTPUT---"
+
+// ExtensionEvent is a single structured event emitted by an extension, one per NDJSON
+// line after extensionOutputSentinel.
+type ExtensionEvent struct {
+	Type    ExtensionEventType `json:"type"`
+	Finding *ExtensionFinding  `json:"finding,omitempty"`
+	Message string             `json:"message,omitempty"`
+}
+
+// ExtensionFinding is a single issue reported by an extension, normalized enough to be
+// aggregated across multiple extensions into one consolidated report.
+type ExtensionFinding struct {
+	Title    string `json:"title"`
+	Severity string `json:"severity"`
+	Path     string `json:"path,omitempty"`
+}
+
+// ExtensionResult is the structured outcome of running one or more extensions: their
+// combined findings, any errors they reported, and the highest exit code seen.
+type ExtensionResult struct {
+	ExitCode int                `json:"exitCode"`
+	Findings []ExtensionFinding `json:"findings,omitempty"`
+	Errors   []string           `json:"errors,omitempty"`
+}
+
+// parseExtensionOutput splits an extension's captured stdout into its legacy
+// human-readable passthrough (everything before extensionOutputSentinel) and its
+// structured events (one ExtensionEvent per NDJSON line after it). When the sentinel is
+// absent, the whole stream is passthrough and no events are returned.
+func parseExtensionOutput(r io.Reader) (passthrough string, events []ExtensionEvent, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	var passthroughLines []string
+	inTrailer := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if !inTrailer && line == extensionOutputSentinel {
+			inTrailer = true
+			continue
+		}
+
+		if !inTrailer {
+			passthroughLines = append(passthroughLines, line)
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var event ExtensionEvent
+		if unmarshalErr := json.Unmarshal([]byte(line), &event); unmarshalErr != nil {
+			return "", nil, fmt.Errorf("failed to parse extension output event: %w", unmarshalErr)
+		}
+		events = append(events, event)
+	}
+
+	if scanErr := scanner.Err(); scanErr != nil {
+		return "", nil, scanErr
+	}
+
+	return strings.Join(passthroughLines, "\n"), events, nil
+}
+
+// extensionResultFromEvents collects the findings and error messages out of a parsed
+// extension event stream into a single-extension ExtensionResult.
+func extensionResultFromEvents(events []ExtensionEvent, exitCode int) ExtensionResult {
+	result := ExtensionResult{ExitCode: exitCode}
+
+	for _, event := range events {
+		switch event.Type {
+		case ExtensionEventFinding:
+			if event.Finding != nil {
+				result.Findings = append(result.Findings, *event.Finding)
+			}
+		case ExtensionEventError:
+			result.Errors = append(result.Errors, event.Message)
+		}
+	}
+
+	return result
+}
+
+// aggregateExtensionResults merges the findings, errors and exit codes of several
+// extension runs into a single result, e.g. when one command triggers both an SBOM and a
+// depgraph extension.
+func aggregateExtensionResults(results []ExtensionResult) ExtensionResult {
+	merged := ExtensionResult{}
+
+	for _, result := range results {
+		merged.Findings = append(merged.Findings, result.Findings...)
+		merged.Errors = append(merged.Errors, result.Errors...)
+		if result.ExitCode > merged.ExitCode {
+			merged.ExitCode = result.ExitCode
+		}
+	}
+
+	return merged
+}
+
+// sarifSchemaURI and sarifVersion identify the SARIF 2.1.0 spec in the "$schema"/"version"
+// fields required at the top of every SARIF log.
+const (
+	sarifSchemaURI = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+	sarifVersion   = "2.1.0"
+)
+
+// sarifLog is the minimal SARIF 2.1.0 document shape needed to report extension findings.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name string `json:"name"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifLevelFromSeverity maps an ExtensionFinding's free-form severity onto the fixed set
+// of levels SARIF results are allowed to use.
+func sarifLevelFromSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "high":
+		return "error"
+	case "medium":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// sarifFromExtensionResult converts an aggregated ExtensionResult into a SARIF log with a
+// single run, one result per finding.
+func sarifFromExtensionResult(result ExtensionResult) sarifLog {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "snyk"}}}
+
+	for _, finding := range result.Findings {
+		sarifResultEntry := sarifResult{
+			RuleID:  finding.Title,
+			Level:   sarifLevelFromSeverity(finding.Severity),
+			Message: sarifMessage{Text: finding.Title},
+		}
+		if finding.Path != "" {
+			sarifResultEntry.Locations = []sarifLocation{
+				{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: finding.Path}}},
+			}
+		}
+		run.Results = append(run.Results, sarifResultEntry)
+	}
+
+	return sarifLog{Schema: sarifSchemaURI, Version: sarifVersion, Runs: []sarifRun{run}}
+}
+
+// renderExtensionResult formats an aggregated extension result per --output-format: "json"
+// produces the consolidated report as JSON, "sarif" as a SARIF 2.1.0 log. Any other value is
+// rejected rather than silently falling back to a different shape the caller didn't ask for.
+func renderExtensionResult(result ExtensionResult, outputFormat string) (string, error) {
+	switch outputFormat {
+	case "json":
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(jsonBytes), nil
+	case "sarif":
+		jsonBytes, err := json.MarshalIndent(sarifFromExtensionResult(result), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(jsonBytes), nil
+	default:
+		return "", fmt.Errorf(`unsupported --output-format %q: must be "json" or "sarif"`, outputFormat)
+	}
+}
@@ -0,0 +1,132 @@
+package cliv2
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExtensionOutput_NoSentinelIsPurePassthrough(t *testing.T) {
+	input := "line one\nline two\n"
+
+	passthrough, events, err := parseExtensionOutput(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if passthrough != "line one\nline two" {
+		t.Errorf("passthrough = %q", passthrough)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %d", len(events))
+	}
+}
+
+func TestParseExtensionOutput_SentinelWithMultipleEvents(t *testing.T) {
+	input := strings.Join([]string{
+		"human readable output",
+		extensionOutputSentinel,
+		`{"type":"finding","finding":{"title":"SQL Injection","severity":"high","path":"src/db.go"}}`,
+		`{"type":"progress","message":"50%"}`,
+		`{"type":"error","message":"failed to scan vendor/"}`,
+		"",
+	}, "\n")
+
+	passthrough, events, err := parseExtensionOutput(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if passthrough != "human readable output" {
+		t.Errorf("passthrough = %q", passthrough)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	if events[0].Type != ExtensionEventFinding || events[0].Finding == nil || events[0].Finding.Title != "SQL Injection" {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Type != ExtensionEventProgress || events[1].Message != "50%" {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+	if events[2].Type != ExtensionEventError || events[2].Message != "failed to scan vendor/" {
+		t.Errorf("unexpected third event: %+v", events[2])
+	}
+}
+
+func TestAggregateExtensionResults_MergesAcrossExtensions(t *testing.T) {
+	sbomResult := ExtensionResult{
+		ExitCode: SNYK_EXIT_CODE_OK,
+		Findings: []ExtensionFinding{{Title: "outdated dependency", Severity: "medium"}},
+	}
+	depgraphResult := ExtensionResult{
+		ExitCode: SNYK_EXIT_CODE_ERROR,
+		Findings: []ExtensionFinding{{Title: "vulnerable transitive dep", Severity: "critical"}},
+		Errors:   []string{"depgraph: partial scan"},
+	}
+
+	merged := aggregateExtensionResults([]ExtensionResult{sbomResult, depgraphResult})
+
+	if merged.ExitCode != SNYK_EXIT_CODE_ERROR {
+		t.Errorf("ExitCode = %d, want %d", merged.ExitCode, SNYK_EXIT_CODE_ERROR)
+	}
+	if len(merged.Findings) != 2 {
+		t.Fatalf("expected 2 merged findings, got %d", len(merged.Findings))
+	}
+	if len(merged.Errors) != 1 || merged.Errors[0] != "depgraph: partial scan" {
+		t.Errorf("unexpected merged errors: %v", merged.Errors)
+	}
+}
+
+func TestSarifLevelFromSeverity(t *testing.T) {
+	tests := map[string]string{
+		"critical": "error",
+		"high":     "error",
+		"medium":   "warning",
+		"low":      "note",
+		"":         "note",
+	}
+
+	for severity, expectedLevel := range tests {
+		if got := sarifLevelFromSeverity(severity); got != expectedLevel {
+			t.Errorf("sarifLevelFromSeverity(%q) = %q, want %q", severity, got, expectedLevel)
+		}
+	}
+}
+
+func TestRenderExtensionResult_Sarif(t *testing.T) {
+	result := ExtensionResult{
+		Findings: []ExtensionFinding{{Title: "hardcoded secret", Severity: "critical", Path: "config.go"}},
+	}
+
+	rendered, err := renderExtensionResult(result, "sarif")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(rendered, `"$schema"`) || !strings.Contains(rendered, sarifVersion) {
+		t.Errorf("rendered SARIF missing schema/version fields: %s", rendered)
+	}
+	if !strings.Contains(rendered, `"ruleId": "hardcoded secret"`) || !strings.Contains(rendered, `"level": "error"`) {
+		t.Errorf("rendered SARIF missing expected result fields: %s", rendered)
+	}
+}
+
+func TestRenderExtensionResult_RejectsUnknownFormat(t *testing.T) {
+	_, err := renderExtensionResult(ExtensionResult{}, "jsonn")
+	if err == nil {
+		t.Fatal("expected an error for an unrecognized --output-format, got nil")
+	}
+}
+
+func TestExtensionDeadlineExceeded(t *testing.T) {
+	if extensionDeadlineExceeded(context.Background()) {
+		t.Error("expected a fresh background context to not be deadline-exceeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	time.Sleep(5 * time.Millisecond)
+
+	if !extensionDeadlineExceeded(ctx) {
+		t.Error("expected an expired context to be deadline-exceeded")
+	}
+}
@@ -0,0 +1,227 @@
+package cliv2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// socks5Version is the only SOCKS protocol version this listener accepts.
+const socks5Version = 0x05
+
+// socks5CmdConnect is the only SOCKS5 command this listener implements; BIND and
+// UDP ASSOCIATE aren't needed for a forward proxy that only relays outbound TCP.
+const socks5CmdConnect = 0x01
+
+// socks5AddrIPv4, socks5AddrDomain and socks5AddrIPv6 are the SOCKS5 address types used in
+// both the client's request and this server's reply.
+const (
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+)
+
+// ListenWrapperProxy listens on 127.0.0.1:port as either a SOCKS5 proxy or a plain HTTP
+// CONNECT proxy, depending on proxyScheme, and serves accepted connections in the
+// background until the listener is closed.
+func ListenWrapperProxy(proxyScheme string, port int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	go serveWrapperProxy(listener, proxyScheme)
+
+	return listener, nil
+}
+
+func serveWrapperProxy(listener net.Listener, proxyScheme string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		if proxyScheme == SNYK_PROXY_SCHEME_SOCKS5 {
+			go handleSocks5Connection(conn)
+		} else {
+			go handleHTTPConnectConnection(conn)
+		}
+	}
+}
+
+// handleSocks5Connection implements the minimal SOCKS5 handshake (RFC 1928, no-auth only)
+// and the CONNECT command, then relays bytes between the client and the requested target.
+func handleSocks5Connection(conn net.Conn) {
+	defer conn.Close()
+
+	target, err := socks5Handshake(conn)
+	if err != nil {
+		return
+	}
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		writeSocks5Reply(conn, 0x05) // general failure
+		return
+	}
+	defer upstream.Close()
+
+	writeSocks5Reply(conn, 0x00) // succeeded
+	relay(conn, upstream)
+}
+
+func socks5Handshake(conn net.Conn) (target string, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", errors.New("unsupported SOCKS version")
+	}
+
+	methods := make([]byte, header[1])
+	if _, err = io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	if _, err = conn.Write([]byte{socks5Version, 0x00}); err != nil { // no auth required
+		return "", err
+	}
+
+	request := make([]byte, 4)
+	if _, err = io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socks5Version || request[1] != socks5CmdConnect {
+		return "", errors.New("unsupported SOCKS5 request")
+	}
+
+	host, err := readSocks5Address(conn, request[3])
+	if err != nil {
+		return "", err
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err = io.ReadFull(conn, portBytes); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%d", host, binary.BigEndian.Uint16(portBytes)), nil
+}
+
+func readSocks5Address(conn net.Conn, addrType byte) (string, error) {
+	switch addrType {
+	case socks5AddrIPv4:
+		raw := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, raw); err != nil {
+			return "", err
+		}
+		return net.IP(raw).String(), nil
+	case socks5AddrIPv6:
+		raw := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(conn, raw); err != nil {
+			return "", err
+		}
+		return net.IP(raw).String(), nil
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		raw := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, raw); err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	default:
+		return "", errors.New("unsupported SOCKS5 address type")
+	}
+}
+
+func writeSocks5Reply(conn net.Conn, replyCode byte) {
+	conn.Write([]byte{socks5Version, replyCode, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+// handleHTTPConnectConnection implements the plain HTTP CONNECT proxy method used when
+// --proxy-scheme is "http", relaying bytes once the tunnel is established.
+func handleHTTPConnectConnection(conn net.Conn) {
+	defer conn.Close()
+
+	request, err := readHTTPConnectRequest(conn)
+	if err != nil {
+		return
+	}
+
+	upstream, err := net.Dial("tcp", request)
+	if err != nil {
+		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+		return
+	}
+	defer upstream.Close()
+
+	conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	relay(conn, upstream)
+}
+
+func readHTTPConnectRequest(conn net.Conn) (target string, err error) {
+	buffer := make([]byte, 0, 1024)
+	chunk := make([]byte, 256)
+
+	for {
+		n, readErr := conn.Read(chunk)
+		if n > 0 {
+			buffer = append(buffer, chunk[:n]...)
+		}
+		if idx := indexOfHeaderEnd(buffer); idx >= 0 {
+			var method, host, proto string
+			if _, scanErr := fmt.Sscanf(string(buffer[:idx]), "%s %s %s", &method, &host, &proto); scanErr != nil {
+				return "", scanErr
+			}
+			if method != "CONNECT" {
+				return "", errors.New("only CONNECT is supported")
+			}
+			return host, nil
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+	}
+}
+
+func indexOfHeaderEnd(buffer []byte) int {
+	for i := 0; i+3 < len(buffer); i++ {
+		if buffer[i] == '\r' && buffer[i+1] == '\n' && buffer[i+2] == '\r' && buffer[i+3] == '\n' {
+			return i
+		}
+	}
+	return -1
+}
+
+// halfCloser is implemented by *net.TCPConn; closing the write side lets the peer observe
+// EOF on its read while the other relay direction keeps running.
+type halfCloser interface {
+	CloseWrite() error
+}
+
+// relay copies in both directions until each side has seen EOF, half-closing the write
+// side of the destination as each direction finishes rather than tearing down the whole
+// connection after only one direction completes.
+func relay(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+
+	copyDirection := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if closer, ok := dst.(halfCloser); ok {
+			closer.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+
+	go copyDirection(a, b)
+	go copyDirection(b, a)
+
+	<-done
+	<-done
+}
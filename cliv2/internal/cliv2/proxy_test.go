@@ -0,0 +1,159 @@
+package cliv2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startEchoServer starts a TCP server that echoes back everything it reads, returning its
+// listener so the caller can read the assigned address and shut it down.
+func startEchoServer(t *testing.T) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start echo server: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				io.Copy(c, c)
+			}(conn)
+		}
+	}()
+
+	return listener
+}
+
+func listenerPort(t *testing.T, listener net.Listener) int {
+	t.Helper()
+
+	tcpAddr, ok := listener.Addr().(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", listener.Addr())
+	}
+	return tcpAddr.Port
+}
+
+func TestListenWrapperProxy_Socks5RelaysToTarget(t *testing.T) {
+	echoListener := startEchoServer(t)
+	defer echoListener.Close()
+	echoPort := listenerPort(t, echoListener)
+
+	proxyListener, err := ListenWrapperProxy(SNYK_PROXY_SCHEME_SOCKS5, 0)
+	if err != nil {
+		t.Fatalf("failed to start wrapper proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	proxyPort := listenerPort(t, proxyListener)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", proxyPort))
+	if err != nil {
+		t.Fatalf("failed to dial wrapper proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// greeting: version 5, one method, no-auth
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		t.Fatalf("failed to write SOCKS5 greeting: %v", err)
+	}
+	greetingReply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greetingReply); err != nil {
+		t.Fatalf("failed to read SOCKS5 greeting reply: %v", err)
+	}
+	if greetingReply[0] != 0x05 || greetingReply[1] != 0x00 {
+		t.Fatalf("unexpected SOCKS5 greeting reply: %v", greetingReply)
+	}
+
+	// CONNECT request to 127.0.0.1:echoPort
+	request := []byte{0x05, socks5CmdConnect, 0x00, socks5AddrIPv4, 127, 0, 0, 1}
+	portBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(portBytes, uint16(echoPort))
+	request = append(request, portBytes...)
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("failed to write SOCKS5 connect request: %v", err)
+	}
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("failed to read SOCKS5 connect reply: %v", err)
+	}
+	if reply[1] != 0x00 {
+		t.Fatalf("expected SOCKS5 connect to succeed, got reply code %d", reply[1])
+	}
+
+	payload := []byte("hello through socks5")
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("failed to write payload: %v", err)
+	}
+
+	echoed := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatalf("failed to read echoed payload: %v", err)
+	}
+	if string(echoed) != string(payload) {
+		t.Fatalf("echoed payload = %q, want %q", echoed, payload)
+	}
+}
+
+func TestListenWrapperProxy_HTTPConnectRelaysToTarget(t *testing.T) {
+	echoListener := startEchoServer(t)
+	defer echoListener.Close()
+	echoPort := listenerPort(t, echoListener)
+
+	proxyListener, err := ListenWrapperProxy(SNYK_PROXY_SCHEME_HTTP, 0)
+	if err != nil {
+		t.Fatalf("failed to start wrapper proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	proxyPort := listenerPort(t, proxyListener)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", proxyPort))
+	if err != nil {
+		t.Fatalf("failed to dial wrapper proxy: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	target := fmt.Sprintf("127.0.0.1:%d", echoPort)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
+		t.Fatalf("failed to write CONNECT request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	statusLine, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read CONNECT response: %v", err)
+	}
+	if statusLine != "HTTP/1.1 200 Connection Established\r\n" {
+		t.Fatalf("unexpected CONNECT response status line: %q", statusLine)
+	}
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("failed to read trailing CRLF: %v", err)
+	}
+
+	payload := []byte("hello through http connect")
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("failed to write payload: %v", err)
+	}
+
+	echoed := make([]byte, len(payload))
+	if _, err := io.ReadFull(reader, echoed); err != nil {
+		t.Fatalf("failed to read echoed payload: %v", err)
+	}
+	if string(echoed) != string(payload) {
+		t.Fatalf("echoed payload = %q, want %q", echoed, payload)
+	}
+}